@@ -0,0 +1,65 @@
+package nfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// encodeAuthSysCred builds an AUTH_SYS credential body in the wire format
+// decodeAuthSysCred expects, for round-trip testing.
+func encodeAuthSysCred(stamp uint32, machine string, uid, gid uint32, gids []uint32) []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, stamp)
+
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(machine)))
+	buf.WriteString(machine)
+	if pad := (4 - len(machine)%4) % 4; pad > 0 {
+		buf.Write(make([]byte, pad))
+	}
+
+	_ = binary.Write(&buf, binary.BigEndian, uid)
+	_ = binary.Write(&buf, binary.BigEndian, gid)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(gids)))
+	for _, g := range gids {
+		_ = binary.Write(&buf, binary.BigEndian, g)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeAuthSysCredRoundTrip(t *testing.T) {
+	gids := []uint32{1000, 27, 100}
+	cred := encodeAuthSysCred(12345, "client.example.com", 1000, 1000, gids)
+
+	caller, err := decodeAuthSysCred(cred)
+	if err != nil {
+		t.Fatalf("decodeAuthSysCred: %v", err)
+	}
+	if caller.UID != 1000 {
+		t.Errorf("UID = %d, want 1000", caller.UID)
+	}
+	if caller.GID != 1000 {
+		t.Errorf("GID = %d, want 1000", caller.GID)
+	}
+	if !reflect.DeepEqual(caller.GIDs, gids) {
+		t.Errorf("GIDs = %v, want %v", caller.GIDs, gids)
+	}
+}
+
+func TestDecodeAuthSysCredRejectsExcessiveGidCount(t *testing.T) {
+	cred := encodeAuthSysCred(0, "h", 0, 0, make([]uint32, maxAuthSysGids+1))
+
+	if _, err := decodeAuthSysCred(cred); err == nil {
+		t.Fatal("decodeAuthSysCred: want error for a gid count over maxAuthSysGids, got nil")
+	}
+}
+
+func TestDecodeAuthSysCredRejectsTruncatedBody(t *testing.T) {
+	cred := encodeAuthSysCred(0, "h", 0, 0, []uint32{1, 2, 3})
+	truncated := cred[:len(cred)-2]
+
+	if _, err := decodeAuthSysCred(truncated); err == nil {
+		t.Fatal("decodeAuthSysCred: want error for a body shorter than its claimed gid count, got nil")
+	}
+}
@@ -0,0 +1,93 @@
+package nfs
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+)
+
+// maxRecordSize bounds the total size of a decoded RPC call assembled from
+// record-marked fragments (RFC 1831 §10). Like maxOpaqueAuthLen, this is
+// parsed ahead of any authentication, so a peer claiming an enormous
+// fragment length must not be able to force an unbounded allocation.
+const maxRecordSize = 4 << 20 // 4 MiB, comfortably above any real NFS call
+
+// conn is one accepted TCP connection, decoding RFC 1831 record-marked RPC
+// calls from it and dispatching each through Server.dispatchCall.
+type conn struct {
+	*Server
+	net.Conn
+}
+
+// serve reads and dispatches calls from c until the connection errors, the
+// Server starts shutting down, or ctx is done. It checks for shutdown before
+// starting each new call rather than mid-call, so a request already being
+// decoded or handled is allowed to finish — Shutdown waits on numConns, not
+// on serve returning early. A read already waiting for the next call is not
+// interrupted by shutdown.
+func (c *conn) serve(ctx context.Context) {
+	defer c.Conn.Close()
+	defer c.onClose(c.Conn)
+
+	for {
+		if c.shuttingDown() {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		msg, err := c.readRecord()
+		if err != nil {
+			if err != io.EOF {
+				c.logger().Warn("nfs: failed to read record", "remote", c.Conn.RemoteAddr(), "error", err)
+			}
+			return
+		}
+
+		w := c.dispatchCall(ctx, msg, c.Conn.RemoteAddr(), func(args []byte, wrap wrapFunc) response {
+			return newStreamResponse(c.Conn, args, wrap)
+		})
+		if w == nil {
+			continue
+		}
+		if err := w.Flush(); err != nil {
+			c.logger().Warn("nfs: failed to flush reply", "remote", c.Conn.RemoteAddr(), "error", err)
+			return
+		}
+	}
+}
+
+// readRecord reassembles one RPC message from a record-marked stream: one or
+// more fragments, each prefixed with a 4-byte big-endian header whose top bit
+// marks it as the last fragment and whose low 31 bits are its length.
+func (c *conn) readRecord() ([]byte, error) {
+	var msg []byte
+	for {
+		var hdr [4]byte
+		if _, err := io.ReadFull(c.Conn, hdr[:]); err != nil {
+			return nil, err
+		}
+		n := binary.BigEndian.Uint32(hdr[:])
+		last := n&0x80000000 != 0
+		size := n &^ 0x80000000
+
+		if uint64(len(msg))+uint64(size) > maxRecordSize {
+			return nil, errors.New("nfs: record too large")
+		}
+
+		frag := make([]byte, size)
+		if _, err := io.ReadFull(c.Conn, frag); err != nil {
+			return nil, err
+		}
+		msg = append(msg, frag...)
+
+		if last {
+			return msg, nil
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package nfs
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"time"
+)
+
+// dispatchCall decodes a single RPC call carried in raw, authenticates and
+// unwraps it via s.authenticator(), resolves its handler, and invokes it.
+// newResponse builds the transport-specific response (stream or datagram)
+// once the call's (now-plain) arguments and wrap function are known. This is
+// the one dispatch path both Serve/conn.serve (TCP) and ServePacket (UDP)
+// go through, so authentication, message wrapping, and Hooks instrumentation
+// behave identically regardless of transport.
+//
+// It returns the response to Flush, or nil if the call was rejected before a
+// handler ran (decode failure, auth failure, no matching handler, or unwrap
+// failure) or the handler returned an error — nothing is flushed back in
+// those cases.
+func (s *Server) dispatchCall(ctx context.Context, raw []byte, remote net.Addr, newResponse func(args []byte, wrap wrapFunc) response) response {
+	call, err := decodeRPCCall(bytes.NewReader(raw))
+	if err != nil {
+		s.onReject("decode")
+		s.logger().Warn("nfs: dropping malformed call", "remote", remote, "error", err)
+		return nil
+	}
+
+	ctx, err = s.authenticator().Verify(ctx, call.CredFlavor, call.Cred, call.Verf)
+	if err != nil {
+		s.onReject("auth")
+		s.logger().Warn("nfs: rejecting unauthenticated call", "remote", remote, "error", err)
+		return nil
+	}
+
+	id := HandlerID{protocol: call.Prog, proc: call.Proc}
+	hc := s.handlerFor(call.Prog, call.Proc)
+	if hc == nil {
+		s.onReject("no_handler")
+		s.logger().Warn("nfs: no handler registered", "id", id, "remote", remote)
+		return nil
+	}
+
+	args, err := s.authenticator().Unwrap(ctx, call.Body)
+	if err != nil {
+		s.onReject("unwrap")
+		s.logger().Warn("nfs: failed to unwrap call body", "id", id, "remote", remote, "error", err)
+		return nil
+	}
+
+	w := newResponse(args, func(body []byte) ([]byte, error) {
+		return s.authenticator().Wrap(ctx, body)
+	})
+
+	ctx = s.onRequestStart(ctx, id)
+	start := time.Now()
+	err = hc.Fn(ctx, w, s.Handler)
+	s.onRequestEnd(ctx, id, err, time.Since(start))
+	if err != nil {
+		s.logger().Warn("nfs: handler failed", "id", id, "remote", remote, "error", err)
+		return nil
+	}
+	return w
+}
@@ -0,0 +1,86 @@
+package nfs
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestHooksFireFromDispatchCall verifies dispatchCall drives the Hooks
+// callbacks it's documented to: OnRequestStart/OnRequestEnd around a
+// successfully dispatched call, and OnReject when no handler matches.
+func TestHooksFireFromDispatchCall(t *testing.T) {
+	var started, ended, rejected bool
+	var endErr error
+	var endDur time.Duration
+
+	s := &Server{
+		Hooks: Hooks{
+			OnRequestStart: func(ctx context.Context, id HandlerID) context.Context {
+				started = true
+				return ctx
+			},
+			OnRequestEnd: func(ctx context.Context, id HandlerID, err error, dur time.Duration) {
+				ended = true
+				endErr = err
+				endDur = dur
+			},
+			OnReject: func(reason string) {
+				rejected = true
+			},
+		},
+	}
+	if err := s.Register(1, 1, func(ctx context.Context, w response, userHandler Handler) error {
+		_, err := w.Write([]byte("ok"))
+		return err
+	}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	raw, err := encodeRPCCallMessage(1, defaultProgramVersion, 1, nil)
+	if err != nil {
+		t.Fatalf("encodeRPCCallMessage: %v", err)
+	}
+
+	remote := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	resp := s.dispatchCall(context.Background(), raw, remote, func(args []byte, wrap wrapFunc) response {
+		return newDatagramResponse(nil, remote, args, wrap)
+	})
+	if resp == nil {
+		t.Fatal("dispatchCall returned nil for a call with a registered handler")
+	}
+	if !started {
+		t.Error("OnRequestStart did not fire")
+	}
+	if !ended {
+		t.Error("OnRequestEnd did not fire")
+	}
+	if endErr != nil {
+		t.Errorf("OnRequestEnd err = %v, want nil", endErr)
+	}
+	if endDur < 0 {
+		t.Errorf("OnRequestEnd dur = %v, want >= 0", endDur)
+	}
+	if rejected {
+		t.Error("OnReject fired for a call that was dispatched successfully")
+	}
+
+	started, ended, rejected = false, false, false
+	raw, err = encodeRPCCallMessage(99, defaultProgramVersion, 1, nil)
+	if err != nil {
+		t.Fatalf("encodeRPCCallMessage: %v", err)
+	}
+	resp = s.dispatchCall(context.Background(), raw, remote, func(args []byte, wrap wrapFunc) response {
+		return newDatagramResponse(nil, remote, args, wrap)
+	})
+	if resp != nil {
+		t.Fatal("dispatchCall returned non-nil for a call with no registered handler")
+	}
+	if !rejected {
+		t.Error("OnReject did not fire for a call with no registered handler")
+	}
+	if started || ended {
+		t.Error("OnRequestStart/OnRequestEnd fired for a call that was rejected before a handler ran")
+	}
+}
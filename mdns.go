@@ -0,0 +1,63 @@
+package nfs
+
+import (
+	"errors"
+	"net"
+)
+
+// Advertiser publishes and withdraws a service advertisement. AdvertiseMDNS
+// uses it to abstract over the actual mDNS/DNS-SD implementation: wire in a
+// dedicated mDNS library (e.g. zeroconf, mdns) via WithAdvertiser.
+type Advertiser interface {
+	// Advertise publishes a service record for instanceName at addr, with
+	// the given DNS-SD TXT record key/value pairs.
+	Advertise(instanceName string, addr *net.TCPAddr, txt map[string]string) error
+
+	// Unadvertise withdraws the record published by Advertise.
+	Unadvertise() error
+}
+
+// nfsServiceType is the DNS-SD service type NFS exports are conventionally
+// published under.
+const nfsServiceType = "_nfs._tcp"
+
+// errNoAdvertiser is returned by AdvertiseMDNS when no Advertiser has been
+// configured. There's no honest built-in default: actually answering
+// "_nfs._tcp.local." queries means joining the 224.0.0.251:5353 multicast
+// group and implementing RFC 6762/6763 probing and query matching, which is
+// real protocol work, not something to fake with a responder that reports
+// success and advertises nothing.
+var errNoAdvertiser = errors.New("nfs: AdvertiseMDNS: no Advertiser configured; use WithAdvertiser")
+
+// AdvertiseMDNS publishes an "_nfs._tcp.local." service record for this
+// Server's bound address, using the Advertiser configured via WithAdvertiser,
+// so clients on the local network can discover the export without pointing a
+// mount command at a specific host. It returns errNoAdvertiser if no
+// Advertiser has been configured. The advertisement is withdrawn
+// automatically by Shutdown/Close.
+func (s *Server) AdvertiseMDNS(instanceName string, txt map[string]string) error {
+	s.mu.Lock()
+	l := s.listener
+	adv := s.advertiser
+	s.mu.Unlock()
+	if l == nil {
+		return errors.New("nfs: AdvertiseMDNS: call Serve before advertising")
+	}
+	if adv == nil {
+		return errNoAdvertiser
+	}
+	tcpAddr, ok := l.Addr().(*net.TCPAddr)
+	if !ok {
+		return errors.New("nfs: AdvertiseMDNS: listener is not bound to a TCP address")
+	}
+
+	return adv.Advertise(instanceName, tcpAddr, txt)
+}
+
+// WithAdvertiser sets the Advertiser a Server's AdvertiseMDNS publishes
+// through. Without this option, AdvertiseMDNS returns errNoAdvertiser.
+func WithAdvertiser(a Advertiser) ServerOption {
+	return func(s *Server) {
+		s.advertiser = a
+	}
+}
@@ -0,0 +1,69 @@
+// Package nfsmetrics implements nfs.Hooks against common Go metrics
+// backends, so embedders get request-rate and latency visibility without
+// having to write the instrumentation themselves.
+package nfsmetrics
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net"
+	"time"
+
+	nfs "github.com/fanyang89/go-nfs"
+)
+
+// ExpvarHooks publishes RPC counts and in-flight gauges under expvar. Each
+// ExpvarHooks owns its own expvar.Map instances, so multiple Servers in the
+// same process can each get their own ExpvarHooks without colliding.
+//
+// Byte counts for bytes read/written are not tracked: nfs.Hooks has no
+// callback for them, since response doesn't report transferred sizes back to
+// the Server. That's left out of scope here rather than shipped as a gauge
+// that never moves.
+type ExpvarHooks struct {
+	inFlight          expvar.Int
+	total             expvar.Map
+	connections       expvar.Int // cumulative: incremented by OnAccept only, never decremented
+	activeConnections expvar.Int // live: incremented by OnAccept, decremented by OnClose
+}
+
+// NewExpvarHooks creates an ExpvarHooks and publishes its maps under
+// "nfs_<name>_in_flight", "nfs_<name>_total", "nfs_<name>_connections" and
+// "nfs_<name>_active_connections".
+func NewExpvarHooks(name string) *ExpvarHooks {
+	h := &ExpvarHooks{}
+	expvar.Publish(fmt.Sprintf("nfs_%s_in_flight", name), &h.inFlight)
+	expvar.Publish(fmt.Sprintf("nfs_%s_total", name), &h.total)
+	expvar.Publish(fmt.Sprintf("nfs_%s_connections", name), &h.connections)
+	expvar.Publish(fmt.Sprintf("nfs_%s_active_connections", name), &h.activeConnections)
+	return h
+}
+
+// Hooks returns the nfs.Hooks that feed this ExpvarHooks.
+func (h *ExpvarHooks) Hooks() nfs.Hooks {
+	return nfs.Hooks{
+		OnAccept: func(net.Conn) {
+			h.connections.Add(1)
+			h.activeConnections.Add(1)
+		},
+		OnRequestStart: func(ctx context.Context, id nfs.HandlerID) context.Context {
+			h.inFlight.Add(1)
+			return ctx
+		},
+		OnRequestEnd: func(_ context.Context, id nfs.HandlerID, err error, _ time.Duration) {
+			h.inFlight.Add(-1)
+			status := "ok"
+			if err != nil {
+				status = "error"
+			}
+			h.total.Add(fmt.Sprintf("%s:%s", id, status), 1)
+		},
+		OnReject: func(reason string) {
+			h.total.Add("reject:"+reason, 1)
+		},
+		OnClose: func(net.Conn) {
+			h.activeConnections.Add(-1)
+		},
+	}
+}
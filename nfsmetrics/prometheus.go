@@ -0,0 +1,115 @@
+package nfsmetrics
+
+import (
+	"context"
+	"net"
+	"time"
+
+	nfs "github.com/fanyang89/go-nfs"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusHooks publishes RPC counts, latencies and connection counts as
+// prometheus metrics. It implements prometheus.Collector, so it can be
+// registered directly with a prometheus.Registerer.
+//
+// Byte counts for bytes read/written are not tracked: nfs.Hooks has no
+// callback for them, since response doesn't report transferred sizes back to
+// the Server. That's left out of scope here rather than shipped as a metric
+// that never moves.
+type PrometheusHooks struct {
+	inFlight          prometheus.Gauge
+	total             *prometheus.CounterVec
+	duration          *prometheus.HistogramVec
+	rejected          *prometheus.CounterVec
+	connections       prometheus.Counter
+	activeConnections prometheus.Gauge
+}
+
+// NewPrometheusHooks creates a PrometheusHooks with metric names prefixed by
+// namespace (e.g. "nfs"), ready to be registered and to produce nfs.Hooks.
+func NewPrometheusHooks(namespace string) *PrometheusHooks {
+	return &PrometheusHooks{
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "rpcs_in_flight",
+			Help:      "Number of RPCs currently being handled.",
+		}),
+		total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rpcs_total",
+			Help:      "Total RPCs handled, by protocol, procedure and status.",
+		}, []string{"protocol", "proc", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "rpc_duration_seconds",
+			Help:      "RPC handler latency, by protocol and procedure.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"protocol", "proc"}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rpcs_rejected_total",
+			Help:      "RPCs that were never dispatched, by reason.",
+		}, []string{"reason"}),
+		connections: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "connections_accepted_total",
+			Help:      "Total stream connections accepted.",
+		}),
+		activeConnections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "connections_active",
+			Help:      "Number of stream connections currently being served.",
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (h *PrometheusHooks) Describe(ch chan<- *prometheus.Desc) {
+	h.inFlight.Describe(ch)
+	h.total.Describe(ch)
+	h.duration.Describe(ch)
+	h.rejected.Describe(ch)
+	h.connections.Describe(ch)
+	h.activeConnections.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (h *PrometheusHooks) Collect(ch chan<- prometheus.Metric) {
+	h.inFlight.Collect(ch)
+	h.total.Collect(ch)
+	h.duration.Collect(ch)
+	h.rejected.Collect(ch)
+	h.connections.Collect(ch)
+	h.activeConnections.Collect(ch)
+}
+
+// Hooks returns the nfs.Hooks that feed this PrometheusHooks.
+func (h *PrometheusHooks) Hooks() nfs.Hooks {
+	return nfs.Hooks{
+		OnAccept: func(net.Conn) {
+			h.connections.Inc()
+			h.activeConnections.Inc()
+		},
+		OnRequestStart: func(ctx context.Context, id nfs.HandlerID) context.Context {
+			h.inFlight.Inc()
+			return ctx
+		},
+		OnRequestEnd: func(_ context.Context, id nfs.HandlerID, err error, dur time.Duration) {
+			h.inFlight.Dec()
+			protocol, proc := id.LabelPair()
+			status := "ok"
+			if err != nil {
+				status = "error"
+			}
+			h.total.WithLabelValues(protocol, proc, status).Inc()
+			h.duration.WithLabelValues(protocol, proc).Observe(dur.Seconds())
+		},
+		OnReject: func(reason string) {
+			h.rejected.WithLabelValues(reason).Inc()
+		},
+		OnClose: func(net.Conn) {
+			h.activeConnections.Dec()
+		},
+	}
+}
@@ -0,0 +1,220 @@
+package nfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+// Well-known portmap/rpcbind program and procedure numbers (RFC 1833). SET
+// and UNSET keep the same procedure numbers across portmap v2 and rpcbind
+// v3; only the arguments differ (rpcbind v3 additionally carries a netid and
+// universal address, which we don't need for a same-host registration).
+const (
+	portmapProg      = 100000
+	portmapVers2     = 2
+	portmapProcSet   = 1
+	portmapProcUnset = 2
+
+	portmapIPProtoTCP = 6
+	portmapIPProtoUDP = 17
+
+	portmapAddr               = "127.0.0.1:111"
+	portmapReregisterInterval = 5 * time.Minute
+)
+
+// portmapping is one (IP protocol, port) pair to register for every served
+// program, e.g. {TCP, <tcp listener port>} and, if ServePacket is also in
+// use, {UDP, <packet conn port>}.
+type portmapping struct {
+	proto uint32
+	port  uint16
+}
+
+// portmapRegistration tracks one RegisterWithPortmap call's background
+// reregistration goroutine.
+type portmapRegistration struct {
+	cancel context.CancelFunc // triggers a real unregister, via ctx.Done in the goroutine below
+
+	// superseded is closed when a later RegisterWithPortmap call takes over
+	// the same Server, so this registration's goroutine can exit without
+	// unregistering mappings the new registration has already re-set.
+	superseded chan struct{}
+}
+
+// RegisterWithPortmap announces every (protocol, proc) program/version pair
+// served by s to the local portmap/rpcbind service (RFC 1833), on its TCP
+// listener's port and, if ServePacket has also been started, its UDP
+// PacketConn's port — never guessing a UDP port from the TCP listener. It
+// must be called after Serve has bound a listener. Registrations are
+// refreshed on an interval so a restarted rpcbind picks the export back up,
+// and are removed when ctx is done or Shutdown/Close runs. Calling
+// RegisterWithPortmap again supersedes any previous registration on this
+// Server: the old registration's goroutine exits without unregistering, so
+// it can't race with (and undo) the mappings the new call just set.
+func (s *Server) RegisterWithPortmap(ctx context.Context) error {
+	s.mu.Lock()
+	l := s.listener
+	pc := s.packetConn
+	prevReg := s.portmapReg
+	s.mu.Unlock()
+	if l == nil {
+		return errors.New("nfs: RegisterWithPortmap: call Serve before registering")
+	}
+
+	tport, err := tcpPort(l.Addr())
+	if err != nil {
+		return err
+	}
+	mappings := []portmapping{{portmapIPProtoTCP, tport}}
+	if pc != nil {
+		uport, err := udpPort(pc.LocalAddr())
+		if err != nil {
+			return err
+		}
+		mappings = append(mappings, portmapping{portmapIPProtoUDP, uport})
+	}
+
+	progs := s.registeredPrograms()
+	if err := s.setAll(progs, mappings); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	reg := &portmapRegistration{cancel: cancel, superseded: make(chan struct{})}
+	s.mu.Lock()
+	s.portmapReg = reg
+	s.mu.Unlock()
+
+	if prevReg != nil {
+		close(prevReg.superseded)
+	}
+
+	go func() {
+		ticker := time.NewTicker(portmapReregisterInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-reg.superseded:
+				return
+			case <-ctx.Done():
+				s.unsetAll(progs, mappings)
+				return
+			case <-ticker.C:
+				_ = s.setAll(progs, mappings)
+			}
+		}
+	}()
+	return nil
+}
+
+// registeredPrograms returns the distinct RPC program numbers this Server
+// has handlers for (e.g. the MOUNT and NFS program numbers).
+func (s *Server) registeredPrograms() []uint32 {
+	seen := make(map[uint32]bool)
+	var progs []uint32
+	for id := range s.handlers {
+		if !seen[id.protocol] {
+			seen[id.protocol] = true
+			progs = append(progs, id.protocol)
+		}
+	}
+	return progs
+}
+
+// setAll registers every (prog, mapping) pair with the portmapper, each
+// under prog's real version (s.versionFor), not the portmap protocol's own
+// version used to reach the portmapper itself.
+func (s *Server) setAll(progs []uint32, mappings []portmapping) error {
+	var firstErr error
+	for _, prog := range progs {
+		vers := s.versionFor(prog)
+		for _, m := range mappings {
+			if err := pmapCall(portmapProcSet, prog, vers, m.proto, m.port); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (s *Server) unsetAll(progs []uint32, mappings []portmapping) {
+	for _, prog := range progs {
+		vers := s.versionFor(prog)
+		for _, m := range mappings {
+			_ = pmapCall(portmapProcUnset, prog, vers, m.proto, 0)
+		}
+	}
+}
+
+// pmapCall sends a single best-effort PMAPPROC_SET/UNSET call to the local
+// portmapper over UDP and waits briefly for a reply. The mapping struct is
+// (prog, vers, prot, port), RFC 1833 §"struct pmap".
+func pmapCall(proc, prog, vers, proto uint32, port uint16) error {
+	conn, err := net.Dial("udp", portmapAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var body bytes.Buffer
+	for _, v := range []uint32{prog, vers, proto, uint32(port)} {
+		_ = binary.Write(&body, binary.BigEndian, v)
+	}
+
+	req, err := encodeRPCCallMessage(portmapProg, portmapVers2, proc, body.Bytes())
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	reply := make([]byte, 64)
+	_, err = conn.Read(reply)
+	return err
+}
+
+// encodeRPCCallMessage builds a minimal RPC call message (RFC 1831 §9) with
+// AUTH_NONE credentials and verifier, wrapping the given already-encoded
+// procedure arguments.
+func encodeRPCCallMessage(prog, vers, proc uint32, args []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	fields := []uint32{
+		0, // xid; the portmapper doesn't require a matched xid for our best-effort use
+		0, // msg_type = CALL
+		2, // rpcvers
+		prog, vers, proc,
+		0, 0, // AUTH_NONE cred: flavor, length
+		0, 0, // AUTH_NONE verf: flavor, length
+	}
+	for _, v := range fields {
+		if err := binary.Write(&buf, binary.BigEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	buf.Write(args)
+	return buf.Bytes(), nil
+}
+
+// tcpPort extracts the numeric port a listener is bound to.
+func tcpPort(addr net.Addr) (uint16, error) {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return 0, errors.New("nfs: RegisterWithPortmap: listener is not bound to a TCP address")
+	}
+	return uint16(tcpAddr.Port), nil
+}
+
+// udpPort extracts the numeric port a PacketConn is bound to.
+func udpPort(addr net.Addr) (uint16, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, errors.New("nfs: RegisterWithPortmap: packet conn is not bound to a UDP address")
+	}
+	return uint16(udpAddr.Port), nil
+}
@@ -0,0 +1,27 @@
+package nfs
+
+import "testing"
+
+// TestVersionForDefaultsAndOverrides guards against registering a program
+// under the wrong RPC version (portmapVers2, or any other stand-in) instead
+// of the version it actually serves.
+func TestVersionForDefaultsAndOverrides(t *testing.T) {
+	s := &Server{}
+
+	if got := s.versionFor(100003); got != defaultProgramVersion {
+		t.Errorf("versionFor(100003) = %d, want default %d", got, defaultProgramVersion)
+	}
+
+	WithProgramVersion(100003, 4)(s)
+	if got := s.versionFor(100003); got != 4 {
+		t.Errorf("versionFor(100003) = %d, want overridden 4", got)
+	}
+
+	if got := s.versionFor(100005); got != defaultProgramVersion {
+		t.Errorf("versionFor(100005) = %d, want default %d for an unrelated program", got, defaultProgramVersion)
+	}
+
+	if got := uint32(portmapVers2); got == defaultProgramVersion {
+		t.Fatalf("test setup: portmapVers2 (%d) must differ from defaultProgramVersion (%d) to catch the mixup this test guards against", got, defaultProgramVersion)
+	}
+}
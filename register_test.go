@@ -0,0 +1,44 @@
+package nfs
+
+import (
+	"context"
+	"testing"
+)
+
+// TestServersHaveIndependentHandlerTables verifies the core promise of
+// NewServer/Register: each Server owns its own handler table, so two
+// Servers built independently don't see each other's registrations.
+func TestServersHaveIndependentHandlerTables(t *testing.T) {
+	var called1, called2 bool
+
+	s1 := NewServer(nil, WithHandler(1, 1, func(ctx context.Context, w response, userHandler Handler) error {
+		called1 = true
+		return nil
+	}))
+	s2 := NewServer(nil, WithHandler(2, 1, func(ctx context.Context, w response, userHandler Handler) error {
+		called2 = true
+		return nil
+	}))
+
+	if hc := s1.handlerFor(2, 1); hc != nil {
+		t.Fatal("s1.handlerFor(2, 1) found s2's handler; handler tables are not independent")
+	}
+	if hc := s2.handlerFor(1, 1); hc != nil {
+		t.Fatal("s2.handlerFor(1, 1) found s1's handler; handler tables are not independent")
+	}
+
+	if hc := s1.handlerFor(1, 1); hc == nil {
+		t.Fatal("s1.handlerFor(1, 1) = nil, want its own registered handler")
+	} else if err := hc.Fn(context.Background(), nil, nil); err != nil {
+		t.Fatalf("s1's handler: %v", err)
+	}
+	if hc := s2.handlerFor(2, 1); hc == nil {
+		t.Fatal("s2.handlerFor(2, 1) = nil, want its own registered handler")
+	} else if err := hc.Fn(context.Background(), nil, nil); err != nil {
+		t.Fatalf("s2's handler: %v", err)
+	}
+
+	if !called1 || !called2 {
+		t.Fatal("expected both handlers to have run")
+	}
+}
@@ -0,0 +1,207 @@
+package nfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+// maxOpaqueAuthLen bounds the opaque_auth credential/verifier bodies this
+// package will allocate for. It's sized well above AUTH_SYS's legitimate body
+// (stamp + machine name + uid + gid + NGROUPS_MAX gids) to also leave room
+// for an out-of-tree RPCSEC_GSS Authenticator's Kerberos tickets, which can
+// run a few KB once a PAC is embedded. It exists to stop a crafted length
+// prefix from forcing a multi-gigabyte allocation per call, since this is
+// parsed before any authentication or connection-level trust has been
+// established.
+const maxOpaqueAuthLen = 8192
+
+// rpcCallHeader is the fixed-size prefix common to every RPC call message
+// (RFC 1831 §9): xid, message type, rpc version, program, version and
+// procedure. The variable-length opaque_auth cred/verf that follows it is
+// left for the caller to decode.
+type rpcCallHeader struct {
+	Xid     uint32
+	Msgtype uint32
+	Rpcvers uint32
+	Prog    uint32
+	Vers    uint32
+	Proc    uint32
+}
+
+func decodeRPCCallHeader(r io.Reader) (rpcCallHeader, error) {
+	var h rpcCallHeader
+	err := binary.Read(r, binary.BigEndian, &h)
+	return h, err
+}
+
+// rpcCall is a decoded RPC call message: its fixed header, the credential
+// and verifier opaque_auth fields (RFC 1831 §9) ready to hand to an
+// Authenticator, and the remaining, still-possibly-wrapped procedure
+// arguments.
+type rpcCall struct {
+	rpcCallHeader
+	CredFlavor uint32
+	Cred       []byte
+	VerfFlavor uint32
+	Verf       []byte
+	Body       []byte
+}
+
+// decodeRPCCall decodes a whole RPC call message: the fixed header, its
+// opaque_auth credential and verifier, and the raw bytes left over, which
+// are the procedure arguments (possibly wrapped for integrity/privacy by an
+// Authenticator).
+func decodeRPCCall(r io.Reader) (rpcCall, error) {
+	var call rpcCall
+	hdr, err := decodeRPCCallHeader(r)
+	if err != nil {
+		return call, err
+	}
+	call.rpcCallHeader = hdr
+
+	call.CredFlavor, call.Cred, err = decodeOpaqueAuth(r)
+	if err != nil {
+		return call, err
+	}
+	call.VerfFlavor, call.Verf, err = decodeOpaqueAuth(r)
+	if err != nil {
+		return call, err
+	}
+	call.Body, err = io.ReadAll(r)
+	return call, err
+}
+
+// decodeOpaqueAuth decodes one opaque_auth value: a 4-byte flavor followed
+// by a counted, 4-byte-padded opaque body (RFC 1831 §8.2). The count is
+// bounded by maxOpaqueAuthLen before it is used to size an allocation: this
+// is parsed ahead of any authentication, so an unauthenticated caller must
+// not be able to force an arbitrarily large allocation with a single small
+// packet.
+func decodeOpaqueAuth(r io.Reader) (flavor uint32, body []byte, err error) {
+	if err = binary.Read(r, binary.BigEndian, &flavor); err != nil {
+		return 0, nil, err
+	}
+	var n uint32
+	if err = binary.Read(r, binary.BigEndian, &n); err != nil {
+		return 0, nil, err
+	}
+	if n > maxOpaqueAuthLen {
+		return 0, nil, fmt.Errorf("nfs: opaque_auth body too large: %d bytes", n)
+	}
+	body = make([]byte, n)
+	if _, err = io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	if pad := (4 - n%4) % 4; pad > 0 {
+		if _, err = io.CopyN(io.Discard, r, int64(pad)); err != nil {
+			return 0, nil, err
+		}
+	}
+	return flavor, body, nil
+}
+
+// response is the transport-agnostic sink and source a HandleFunc reads its
+// (already-unwrapped) procedure arguments from and writes its XDR reply
+// through. streamResponse and datagramResponse adapt it to the two framings
+// RPC is carried over: TCP's record-marked stream (RFC 1831 §10) and UDP's
+// one-datagram-per-message framing.
+type response interface {
+	io.Reader
+	io.Writer
+
+	// Flush applies the Authenticator's Wrap to the buffered reply, if any,
+	// and sends the result to the peer, framed as the transport requires.
+	// The Server calls Flush once after a HandleFunc returns without error;
+	// a HandleFunc only writes the reply body and does not call Flush itself.
+	Flush() error
+}
+
+// wrapFunc applies an Authenticator's message-level integrity/privacy
+// transform to a reply body before it is framed and sent. dispatchCall always
+// supplies one that calls the Server's Authenticator.Wrap, which for AuthNone
+// and AuthSys returns the body unchanged; a nil wrapFunc also leaves the body
+// unchanged.
+type wrapFunc func(body []byte) ([]byte, error)
+
+// streamResponse buffers a single RPC reply and flushes it onto a
+// record-marked stream, prefixing the payload with a 4-byte fragment header
+// whose top bit marks it as the final (and, here, only) fragment of the
+// message. Reads come from the call's already-unwrapped argument bytes.
+type streamResponse struct {
+	w    io.Writer
+	args *bytes.Reader
+	buf  bytes.Buffer
+	wrap wrapFunc
+}
+
+func newStreamResponse(w io.Writer, args []byte, wrap wrapFunc) *streamResponse {
+	return &streamResponse{w: w, args: bytes.NewReader(args), wrap: wrap}
+}
+
+func (r *streamResponse) Read(p []byte) (int, error) {
+	return r.args.Read(p)
+}
+
+func (r *streamResponse) Write(p []byte) (int, error) {
+	return r.buf.Write(p)
+}
+
+func (r *streamResponse) Flush() error {
+	body, err := wrapBody(r.wrap, r.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(body))|0x80000000)
+	if _, err := r.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err = r.w.Write(body)
+	r.buf.Reset()
+	return err
+}
+
+// datagramResponse buffers a single RPC reply and flushes it as one UDP
+// datagram back to the client that sent the call. There is no fragment
+// header: the datagram boundary is the message boundary. Reads come from
+// the call's already-unwrapped argument bytes.
+type datagramResponse struct {
+	pc   net.PacketConn
+	addr net.Addr
+	args *bytes.Reader
+	buf  bytes.Buffer
+	wrap wrapFunc
+}
+
+func newDatagramResponse(pc net.PacketConn, addr net.Addr, args []byte, wrap wrapFunc) *datagramResponse {
+	return &datagramResponse{pc: pc, addr: addr, args: bytes.NewReader(args), wrap: wrap}
+}
+
+func (r *datagramResponse) Read(p []byte) (int, error) {
+	return r.args.Read(p)
+}
+
+func (r *datagramResponse) Write(p []byte) (int, error) {
+	return r.buf.Write(p)
+}
+
+func (r *datagramResponse) Flush() error {
+	body, err := wrapBody(r.wrap, r.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = r.pc.WriteTo(body, r.addr)
+	r.buf.Reset()
+	return err
+}
+
+// wrapBody applies wrap to body if set, otherwise returns body unchanged.
+func wrapBody(wrap wrapFunc, body []byte) ([]byte, error) {
+	if wrap == nil {
+		return body, nil
+	}
+	return wrap(body)
+}
@@ -6,7 +6,10 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,25 +18,242 @@ type Server struct {
 	Handler
 	ID [8]byte
 	context.Context
+
+	// handlers is this Server's own, immutable-once-serving table of
+	// procedure handlers. It is populated by Register/WithHandler and must
+	// not be touched concurrently with Serve.
+	handlers map[HandlerID]HandleFunc
+
+	// Authenticator verifies each call's credentials before it reaches the
+	// registered handler. It defaults to AuthNone, preserving the
+	// historical trust-everyone behavior.
+	Authenticator Authenticator
+
+	// Hooks are optional instrumentation callbacks invoked around accept
+	// and dispatch. The zero value runs no instrumentation.
+	Hooks Hooks
+
+	// Logger receives structured log records for this Server. It defaults
+	// to slog.Default().
+	Logger *slog.Logger
+
+	mu         sync.Mutex
+	listener   net.Listener
+	packetConn net.PacketConn
+	inShutdown bool
+	conns      sync.Map // map[string]*conn, keyed by RemoteAddr().String()
+
+	// datagramsInFlight counts dispatchDatagram goroutines started by
+	// ServePacket that haven't returned yet, so Shutdown can wait for a
+	// call it's already decoding/handling the same way it waits on conns
+	// for TCP.
+	datagramsInFlight atomic.Int64
+
+	// portmapReg is the active RegisterWithPortmap registration, if any.
+	// stopDiscovery cancels it, which unregisters its mappings; a fresh call
+	// to RegisterWithPortmap supersedes it without unregistering (the new
+	// registration immediately re-covers the same programs).
+	portmapReg *portmapRegistration
+
+	// advertiser is the mDNS/DNS-SD Advertiser set via WithAdvertiser, if
+	// any, that AdvertiseMDNS publishes through; Shutdown/Close call its
+	// Unadvertise.
+	advertiser Advertiser
+
+	// programVersions records the real RPC version each registered program
+	// runs, set via WithProgramVersion, for RegisterWithPortmap to announce.
+	// HandlerID has no version field (a Server only ever serves one version
+	// of a given program), so this is keyed on program number alone.
+	programVersions map[uint32]uint32
 }
 
-// RegisterMessageHandler registers a handler for a specific XDR procedure.
-func RegisterMessageHandler(protocol uint32, proc uint32, handler HandleFunc) error {
-	if registeredHandlers == nil {
-		registeredHandlers = make(map[HandlerID]HandleFunc)
+// ErrServerClosed is returned by Server.Serve and Server.ServePacket after
+// Shutdown or Close, paralleling http.ErrServerClosed.
+var ErrServerClosed = errors.New("nfs: Server closed")
+
+// ServerOption configures a Server at construction time.
+type ServerOption func(*Server)
+
+// WithHandler registers a handler for a specific XDR procedure on the Server
+// being built by NewServer. It panics if the same (protocol, proc) pair is
+// registered twice, mirroring http.ServeMux's handling of duplicate patterns.
+func WithHandler(protocol uint32, proc uint32, handler HandleFunc) ServerOption {
+	return func(s *Server) {
+		if err := s.Register(protocol, proc, handler); err != nil {
+			panic(err)
+		}
 	}
-	for k := range registeredHandlers {
-		if k.protocol == protocol && k.proc == proc {
-			return errors.New("already registered")
+}
+
+// WithAuthenticator sets the Authenticator a Server uses to verify each
+// call's credentials. Without this option a Server uses AuthNone.
+func WithAuthenticator(a Authenticator) ServerOption {
+	return func(s *Server) {
+		s.Authenticator = a
+	}
+}
+
+// authenticator returns s.Authenticator, defaulting to AuthNone.
+func (s *Server) authenticator() Authenticator {
+	if s.Authenticator == nil {
+		return AuthNone{}
+	}
+	return s.Authenticator
+}
+
+// defaultProgramVersion is the version RegisterWithPortmap announces for a
+// program with no WithProgramVersion override, matching the version
+// virtually every deployed NFSv3/MOUNTv3 client expects.
+const defaultProgramVersion = 3
+
+// WithProgramVersion sets the RPC version RegisterWithPortmap announces for
+// prog, overriding defaultProgramVersion. Get this right: a client's
+// rpcinfo/GETPORT lookup for the real version won't find a mapping
+// registered under the wrong one.
+func WithProgramVersion(prog, vers uint32) ServerOption {
+	return func(s *Server) {
+		if s.programVersions == nil {
+			s.programVersions = make(map[uint32]uint32)
 		}
+		s.programVersions[prog] = vers
+	}
+}
+
+// versionFor returns the RPC version prog should be announced under,
+// defaulting to defaultProgramVersion.
+func (s *Server) versionFor(prog uint32) uint32 {
+	if vers, ok := s.programVersions[prog]; ok {
+		return vers
+	}
+	return defaultProgramVersion
+}
+
+// WithHooks sets the instrumentation callbacks a Server invokes around
+// accept and dispatch.
+func WithHooks(h Hooks) ServerOption {
+	return func(s *Server) {
+		s.Hooks = h
+	}
+}
+
+// WithLogger sets the structured logger a Server uses. Without this option
+// a Server logs to slog.Default().
+func WithLogger(l *slog.Logger) ServerOption {
+	return func(s *Server) {
+		s.Logger = l
+	}
+}
+
+// logger returns s.Logger, defaulting to slog.Default().
+func (s *Server) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.Default()
+	}
+	return s.Logger
+}
+
+// Hooks are optional instrumentation callbacks invoked around the request
+// lifecycle. Every field is nil-checked before use, so a zero Hooks runs no
+// instrumentation.
+type Hooks struct {
+	// OnAccept is called with each newly accepted stream connection, before
+	// it is tracked or served.
+	OnAccept func(net.Conn)
+
+	// OnRequestStart is called once a call's handler has been resolved but
+	// before it runs, and returns the context the handler and OnRequestEnd
+	// should use.
+	OnRequestStart func(ctx context.Context, id HandlerID) context.Context
+
+	// OnRequestEnd is called after a call's handler has returned, with its
+	// error (nil on success) and how long it took to run.
+	OnRequestEnd func(ctx context.Context, id HandlerID, err error, dur time.Duration)
+
+	// OnReject is called when a call could not be dispatched at all (no
+	// matching handler, auth failure, malformed message), with a short,
+	// stable reason string suitable for use as a metric label.
+	OnReject func(reason string)
+
+	// OnClose is called once a stream connection accepted via OnAccept has
+	// finished serving and is about to be closed, pairing with OnAccept for
+	// instrumentation that tracks active (not just cumulative) connections.
+	OnClose func(net.Conn)
+}
+
+func (s *Server) onAccept(c net.Conn) {
+	if s.Hooks.OnAccept != nil {
+		s.Hooks.OnAccept(c)
+	}
+}
+
+func (s *Server) onRequestStart(ctx context.Context, id HandlerID) context.Context {
+	if s.Hooks.OnRequestStart != nil {
+		return s.Hooks.OnRequestStart(ctx, id)
+	}
+	return ctx
+}
+
+func (s *Server) onRequestEnd(ctx context.Context, id HandlerID, err error, dur time.Duration) {
+	if s.Hooks.OnRequestEnd != nil {
+		s.Hooks.OnRequestEnd(ctx, id, err, dur)
+	}
+}
+
+func (s *Server) onReject(reason string) {
+	if s.Hooks.OnReject != nil {
+		s.Hooks.OnReject(reason)
+	}
+}
+
+func (s *Server) onClose(c net.Conn) {
+	if s.Hooks.OnClose != nil {
+		s.Hooks.OnClose(c)
+	}
+}
+
+// NewServer creates a Server backed by its own handler table, so it can run
+// alongside other Servers (e.g. in tests or a multi-tenant daemon) without
+// racing on a shared, process-global registry.
+func NewServer(handler Handler, opts ...ServerOption) *Server {
+	s := &Server{Handler: handler}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register adds a handler for a specific XDR procedure to this Server's own
+// handler table. It must be called before Serve; Register is not safe to
+// call concurrently with Serve or with other calls to Register.
+func (s *Server) Register(protocol uint32, proc uint32, handler HandleFunc) error {
+	if s.handlers == nil {
+		s.handlers = make(map[HandlerID]HandleFunc)
 	}
 	id := HandlerID{protocol, proc}
-	registeredHandlers[id] = handler
+	if _, ok := s.handlers[id]; ok {
+		return errors.New("already registered")
+	}
+	s.handlers[id] = handler
 	return nil
 }
 
-// HandleFunc represents a handler for a specific protocol message.
-type HandleFunc func(ctx context.Context, w *response, userHandler Handler) error
+// DefaultServer is the package-level Server seeded by RegisterMessageHandler
+// and used by the package-level Serve function, preserving the historical
+// global-registry behavior for callers that don't construct their own
+// Server. Embedders that want isolated handler sets should build their own
+// Server with NewServer/Register instead.
+var DefaultServer = &Server{}
+
+// RegisterMessageHandler registers a handler for a specific XDR procedure on
+// DefaultServer.
+func RegisterMessageHandler(protocol uint32, proc uint32, handler HandleFunc) error {
+	return DefaultServer.Register(protocol, proc, handler)
+}
+
+// HandleFunc represents a handler for a specific protocol message. It is
+// transport-agnostic: w is a streamResponse when the call arrived over TCP
+// and a datagramResponse when it arrived over UDP.
+type HandleFunc func(ctx context.Context, w response, userHandler Handler) error
 
 type HandleContext struct {
 	ID HandlerID
@@ -58,11 +278,47 @@ func (id HandlerID) String() string {
 	return fmt.Sprintf("%s %s", svc, NFSProcedure(id.proc).String())
 }
 
-var registeredHandlers map[HandlerID]HandleFunc
+// LabelPair returns (service, proc) strings suitable for use as metric
+// labels, letting nfsmetrics and similar out-of-package instrumentation
+// describe a HandlerID without reaching into its unexported fields.
+func (id HandlerID) LabelPair() (protocol, proc string) {
+	switch id.protocol {
+	case mountServiceID:
+		protocol = "mount"
+	case nfsServiceID:
+		protocol = "nfs"
+	default:
+		protocol = fmt.Sprintf("%v", id.protocol)
+	}
+	return protocol, NFSProcedure(id.proc).String()
+}
+
+// LogValue implements slog.LogValuer, so a HandlerID logs as structured
+// (service, proc) attributes instead of going through the human-readable
+// String/Sprintf path.
+func (id HandlerID) LogValue() slog.Value {
+	protocol, proc := id.LabelPair()
+	return slog.GroupValue(
+		slog.String("service", protocol),
+		slog.String("proc", proc),
+	)
+}
 
 // Serve listens on the provided listener port for incoming client requests.
+// Serve blocks until the listener fails or the Server is shut down, in which
+// case it returns ErrServerClosed.
 func (s *Server) Serve(l net.Listener) error {
+	// Check inShutdown and store l under one lock acquisition, as ServePacket
+	// does, so a concurrent Shutdown/Close either is seen here or sees l.
+	s.mu.Lock()
+	if s.inShutdown {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
 	defer l.Close()
+
 	baseCtx := context.Background()
 	if s.Context != nil {
 		baseCtx = s.Context
@@ -78,6 +334,9 @@ func (s *Server) Serve(l net.Listener) error {
 	for {
 		conn, err := l.Accept()
 		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
 			if ne, ok := err.(net.Error); ok && ne.Timeout() {
 				if tempDelay == 0 {
 					tempDelay = 5 * time.Millisecond
@@ -93,8 +352,13 @@ func (s *Server) Serve(l net.Listener) error {
 			return err
 		}
 		tempDelay = 0
+		s.onAccept(conn)
 		c := s.newConn(conn)
-		go c.serve(baseCtx)
+		s.trackConn(c, true)
+		go func() {
+			defer s.trackConn(c, false)
+			c.serve(baseCtx)
+		}()
 	}
 }
 
@@ -106,25 +370,225 @@ func (s *Server) newConn(nc net.Conn) *conn {
 	return c
 }
 
-// TODO: keep an immutable map for each server instance to have less
-// chance of races.
-func (s *Server) handlerFor(prog uint32, proc uint32) *HandleContext {
-	for k, v := range registeredHandlers {
-		if k.protocol == prog && k.proc == proc {
-			return &HandleContext{
-				ID: HandlerID{
-					protocol: prog,
-					proc:     proc,
-				},
-				Fn: v,
-			}
+func (s *Server) trackConn(c *conn, add bool) {
+	key := c.Conn.RemoteAddr().String()
+	if add {
+		s.conns.Store(key, c)
+	} else {
+		s.conns.Delete(key)
+	}
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inShutdown
+}
+
+func (s *Server) numConns() int {
+	n := 0
+	s.conns.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// Close immediately closes the listener, the packet conn and all active
+// connections, without waiting for in-flight RPCs to finish. For a graceful
+// drain, use Shutdown.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.inShutdown = true
+	l := s.listener
+	pc := s.packetConn
+	s.mu.Unlock()
+	s.stopDiscovery()
+
+	var err error
+	if l != nil {
+		err = l.Close()
+	}
+	if pc != nil {
+		if pcErr := pc.Close(); err == nil {
+			err = pcErr
 		}
 	}
-	return nil
+	s.conns.Range(func(key, value interface{}) bool {
+		value.(*conn).Conn.Close()
+		s.conns.Delete(key)
+		return true
+	})
+	return err
 }
 
-// Serve is a singleton listener paralleling http.Serve
+// stopDiscovery tears down any portmap registration and mDNS advertisement
+// started for this Server.
+func (s *Server) stopDiscovery() {
+	s.mu.Lock()
+	reg := s.portmapReg
+	adv := s.advertiser
+	s.portmapReg = nil
+	s.advertiser = nil
+	s.mu.Unlock()
+
+	if reg != nil {
+		reg.cancel()
+	}
+	if adv != nil {
+		_ = adv.Unadvertise()
+	}
+}
+
+// Shutdown marks the Server as closed so Serve/ServePacket return
+// ErrServerClosed, closes the listener and packet conn so no new connections
+// or datagrams are accepted, then waits for each in-flight call — a TCP
+// connection's current RPC, or a UDP call already handed to dispatchDatagram
+// — to finish before returning. A TCP connection counts until its serve loop
+// returns, and a connection already blocked waiting for its next call is not
+// interrupted, so an idle client keeps Shutdown waiting until it sends a call
+// or disconnects. It returns ctx's error if ctx is done before everything has
+// finished; callers that need a hard stop can follow up with Close.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.inShutdown = true
+	l := s.listener
+	pc := s.packetConn
+	s.mu.Unlock()
+	s.stopDiscovery()
+
+	if l != nil {
+		l.Close()
+	}
+	if pc != nil {
+		pc.Close()
+	}
+
+	const pollInterval = 10 * time.Millisecond
+	t := time.NewTimer(pollInterval)
+	defer t.Stop()
+	for {
+		if s.numConns() == 0 && s.datagramsInFlight.Load() == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			t.Reset(pollInterval)
+		}
+	}
+}
+
+func (s *Server) handlerFor(prog uint32, proc uint32) *HandleContext {
+	id := HandlerID{protocol: prog, proc: proc}
+	fn, ok := s.handlers[id]
+	if !ok {
+		return nil
+	}
+	return &HandleContext{ID: id, Fn: fn}
+}
+
+// Serve is a singleton listener paralleling http.Serve. It runs against
+// DefaultServer's handler table, so it only sees handlers registered via the
+// package-level RegisterMessageHandler.
 func Serve(l net.Listener, handler Handler) error {
-	srv := &Server{Handler: handler}
+	srv := &Server{Handler: handler, handlers: DefaultServer.handlers}
 	return srv.Serve(l)
 }
+
+// maxDatagramSize is large enough for any NFSv2/v3 or MOUNT datagram; RPC
+// over UDP is limited by the underlying IP datagram size in practice.
+const maxDatagramSize = 65507
+
+// ServePacket reads whole RPC datagrams from pc and dispatches each one
+// through the same handler table as Serve, writing the reply back to the
+// datagram's source address. Unlike Serve, there are no persistent
+// per-client connections to track: each datagram is handled in its own
+// goroutine and carries no state between calls.
+func (s *Server) ServePacket(pc net.PacketConn) error {
+	// Check inShutdown and store pc under the same lock acquisition as
+	// Shutdown/Close use to read it, so whichever runs first is the one
+	// that's consistently observed: either this sees a shutdown already in
+	// progress and never starts serving, or a concurrent Shutdown/Close
+	// reads the pc this call just stored and closes it.
+	s.mu.Lock()
+	if s.inShutdown {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.packetConn = pc
+	s.mu.Unlock()
+	baseCtx := context.Background()
+	if s.Context != nil {
+		baseCtx = s.Context
+	}
+	if bytes.Equal(s.ID[:], []byte{0, 0, 0, 0, 0, 0, 0, 0}) {
+		if _, err := rand.Reader.Read(s.ID[:]); err != nil {
+			return err
+		}
+	}
+
+	for {
+		buf := make([]byte, maxDatagramSize)
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.datagramsInFlight.Add(1)
+		go func() {
+			defer s.datagramsInFlight.Add(-1)
+			s.dispatchDatagram(baseCtx, pc, addr, buf[:n])
+		}()
+	}
+}
+
+// dispatchDatagram decodes and dispatches a single RPC call carried in msg
+// via the shared dispatchCall (so it gets the same authentication, message
+// unwrapping/wrapping, and Hooks instrumentation as a TCP-delivered call),
+// then flushes the reply datagram back to addr.
+func (s *Server) dispatchDatagram(ctx context.Context, pc net.PacketConn, addr net.Addr, msg []byte) {
+	w := s.dispatchCall(ctx, msg, addr, func(args []byte, wrap wrapFunc) response {
+		return newDatagramResponse(pc, addr, args, wrap)
+	})
+	if w == nil {
+		return
+	}
+	if err := w.Flush(); err != nil {
+		s.logger().Warn("nfs: failed to flush reply", "remote", addr, "error", err)
+	}
+}
+
+// ServePacket is a singleton listener paralleling Serve, running against
+// DefaultServer's handler table.
+func ServePacket(pc net.PacketConn, handler Handler) error {
+	srv := &Server{Handler: handler, handlers: DefaultServer.handlers}
+	return srv.ServePacket(pc)
+}
+
+// ListenAndServe binds addr on both TCP and UDP and serves handler on each,
+// since portmap/rpcbind clients probe both transports for NFS and MOUNT.
+// It blocks until either listener stops, then closes the other and returns
+// the first error encountered.
+func ListenAndServe(addr string, handler Handler) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		l.Close()
+		return err
+	}
+
+	srv := &Server{Handler: handler, handlers: DefaultServer.handlers}
+	errc := make(chan error, 2)
+	go func() { errc <- srv.Serve(l) }()
+	go func() { errc <- srv.ServePacket(pc) }()
+	err = <-errc
+	srv.Close()
+	return err
+}
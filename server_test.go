@@ -0,0 +1,101 @@
+package nfs
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestShutdownWaitsForInFlightConnection(t *testing.T) {
+	s := &Server{}
+	client, server := net.Pipe()
+	defer client.Close()
+
+	c := s.newConn(server)
+	s.trackConn(c, true)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Shutdown(context.Background())
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v before the in-flight connection was released", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.trackConn(c, false)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Shutdown: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown did not return after the connection was released")
+	}
+}
+
+func TestShutdownWaitsForInFlightDatagram(t *testing.T) {
+	s := &Server{}
+	s.datagramsInFlight.Add(1)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Shutdown(context.Background())
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v before the in-flight datagram was released", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.datagramsInFlight.Add(-1)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Shutdown: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown did not return after the datagram was released")
+	}
+}
+
+func TestShutdownClosesPacketConn(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	s := &Server{}
+	s.mu.Lock()
+	s.packetConn = pc
+	s.mu.Unlock()
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if _, err := pc.WriteTo([]byte("x"), pc.LocalAddr()); err == nil {
+		t.Fatal("packetConn.WriteTo succeeded after Shutdown; want the packet conn to have been closed")
+	}
+}
+
+func TestShutdownRespectsContextDeadline(t *testing.T) {
+	s := &Server{}
+	_, server := net.Pipe()
+	defer server.Close()
+
+	c := s.newConn(server)
+	s.trackConn(c, true) // never released
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown error = %v, want context.DeadlineExceeded", err)
+	}
+}